@@ -0,0 +1,67 @@
+package server
+
+// defaultTemplates holds the HTML rendered when TemplateConfig doesn't
+// provide a Dir, FS, or per-template override for a given file. Every
+// user-facing string goes through {{ .T "..." }} so operators can localize
+// the default UI by supplying TemplateConfig.Translations without having to
+// ship replacement templates just to change the copy.
+var defaultTemplates = map[string]string{
+	tmplLogin: `<!DOCTYPE html>
+<html>
+<head><title>{{ .T "login.title" }}</title></head>
+<body>
+<h1>{{ .T "login.title" }}</h1>
+<ul>
+{{ range .Connectors }}
+<li><a href="/auth/{{ .ID }}?req={{ $.AuthReqID }}">{{ $.T "login.login_with" }} {{ .Name }}</a></li>
+{{ end }}
+</ul>
+</body>
+</html>
+`,
+
+	tmplPassword: `<!DOCTYPE html>
+<html>
+<head><title>{{ .T "password.title" }}</title></head>
+<body>
+<h1>{{ .T "password.title" }}</h1>
+{{ if .Invalid }}<p>{{ .T "password.invalid_credentials" }}</p>{{ end }}
+<form method="post" action="{{ .PostURL }}">
+<input type="hidden" name="req" value="{{ .AuthReqID }}">
+<label>{{ .T "password.username_label" }}<input type="text" name="login" value="{{ .Username }}"></label>
+<label>{{ .T "password.password_label" }}<input type="password" name="password"></label>
+<button type="submit">{{ .T "password.login_button" }}</button>
+</form>
+</body>
+</html>
+`,
+
+	tmplApproval: `<!DOCTYPE html>
+<html>
+<head><title>{{ .T "approval.title" }}</title></head>
+<body>
+<h1>{{ .T "approval.title" }}</h1>
+<p>{{ .Client }} {{ .T "approval.wants_to" }} {{ .User }}:</p>
+<ul>
+{{ range .Scopes }}<li>{{ . }}</li>{{ end }}
+</ul>
+<form method="post" action="">
+<input type="hidden" name="req" value="{{ .AuthReqID }}">
+<button type="submit" name="approval" value="approve">{{ .T "approval.grant_access" }}</button>
+<button type="submit" name="approval" value="deny">{{ .T "approval.cancel" }}</button>
+</form>
+</body>
+</html>
+`,
+
+	tmplOOB: `<!DOCTYPE html>
+<html>
+<head><title>{{ .T "oob.title" }}</title></head>
+<body>
+<h1>{{ .T "oob.title" }}</h1>
+<p>{{ .T "oob.instructions" }}</p>
+<code>{{ .Code }}</code>
+</body>
+</html>
+`,
+}
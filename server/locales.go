@@ -0,0 +1,174 @@
+package server
+
+import (
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultLocale is used to resolve translations when a request doesn't
+// specify an Accept-Language header, or specifies one dex doesn't recognize,
+// and TemplateConfig.DefaultLocale is unset.
+const DefaultLocale = "en"
+
+// defaultTranslations holds the English strings baked into dex's default
+// templates. It's consulted as the ultimate fallback when a key is missing
+// from both the requested locale and DefaultLocale in TemplateConfig.Translations.
+var defaultTranslations = map[string]string{
+	"login.title":      "Log in to Your Account",
+	"login.login_with": "Log in with",
+
+	"password.title":               "Log in to Your Account",
+	"password.username_label":      "Username",
+	"password.password_label":      "Password",
+	"password.login_button":        "Login",
+	"password.invalid_credentials": "Invalid username and password.",
+
+	"approval.title":        "Grant Access",
+	"approval.wants_to":     "wants to access your account",
+	"approval.grant_access": "Grant Access",
+	"approval.cancel":       "Cancel",
+	"scope.offline_access":  "Have offline access",
+	"scope.profile":         "View basic profile information",
+	"scope.email":           "View your email",
+
+	"oob.title":        "Login Code",
+	"oob.instructions": "Please copy this code, switch to your application and paste it there.",
+}
+
+// translator resolves translation keys for a locale against the operator-supplied
+// TemplateConfig.Translations, falling back to DefaultLocale and finally to
+// defaultTranslations. A nil *translator behaves as if no translations were
+// configured.
+type translator struct {
+	defaultLocale string
+	locales       map[string]map[string]string
+
+	warned sync.Map // (locale+"\x00"+key) -> struct{}, guards the missing-key log
+}
+
+func newTranslator(defaultLocale string, locales map[string]map[string]string) *translator {
+	if defaultLocale == "" {
+		defaultLocale = DefaultLocale
+	}
+	return &translator{defaultLocale: defaultLocale, locales: locales}
+}
+
+// translate returns the string for key in locale, falling back to
+// tr.defaultLocale and then to dex's built-in English strings. If no
+// translation exists anywhere, key itself is returned so templates degrade
+// gracefully instead of rendering blank text. Missing keys are logged once
+// per (locale, key) pair.
+func (tr *translator) translate(locale, key string) string {
+	// No Translations configured at all: this operator never opted into
+	// i18n, so falling back to the built-in English strings is expected
+	// behavior, not a misconfiguration worth logging about.
+	if tr == nil || len(tr.locales) == 0 {
+		if s, ok := defaultTranslations[key]; ok {
+			return s
+		}
+		return key
+	}
+	if strs, ok := tr.locales[locale]; ok {
+		if s, ok := strs[key]; ok {
+			return s
+		}
+	}
+	tr.warnMissing(locale, key)
+
+	if locale != tr.defaultLocale {
+		if strs, ok := tr.locales[tr.defaultLocale]; ok {
+			if s, ok := strs[key]; ok {
+				return s
+			}
+		}
+	}
+	if s, ok := defaultTranslations[key]; ok {
+		return s
+	}
+	return key
+}
+
+func (tr *translator) warnMissing(locale, key string) {
+	if _, loaded := tr.warned.LoadOrStore(locale+"\x00"+key, struct{}{}); !loaded {
+		log.Printf("i18n: no translation for key %q in locale %q, falling back", key, locale)
+	}
+}
+
+// has reports whether key has a known translation, either configured by the
+// operator for tr.defaultLocale or baked into dex's built-in English
+// strings. Used to decide whether a dynamic key (e.g. a requested OAuth2
+// scope) is one dex/the operator actually knows how to render.
+func (tr *translator) has(key string) bool {
+	if tr != nil {
+		if strs, ok := tr.locales[tr.defaultLocale]; ok {
+			if _, ok := strs[key]; ok {
+				return true
+			}
+		}
+	}
+	_, ok := defaultTranslations[key]
+	return ok
+}
+
+// resolveLocale picks the best locale for a client's Accept-Language header
+// out of the locales configured in tr, falling back to tr.defaultLocale. It
+// tries an exact BCP-47 match first (e.g. "de-DE"), then the base language
+// (e.g. "de"), in the order the client prefers them.
+func (tr *translator) resolveLocale(acceptLanguage string) string {
+	if tr == nil {
+		return DefaultLocale
+	}
+	for _, want := range parseAcceptLanguage(acceptLanguage) {
+		if _, ok := tr.locales[want]; ok {
+			return want
+		}
+		if i := strings.Index(want, "-"); i != -1 {
+			if base := want[:i]; base != "" {
+				if _, ok := tr.locales[base]; ok {
+					return base
+				}
+			}
+		}
+	}
+	return tr.defaultLocale
+}
+
+// parseAcceptLanguage returns the locales named in an Accept-Language header
+// value, ordered from most to least preferred.
+func parseAcceptLanguage(header string) []string {
+	if header == "" {
+		return nil
+	}
+	type weighted struct {
+		locale string
+		q      float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		locale, q := part, 1.0
+		if i := strings.Index(part, ";q="); i != -1 {
+			locale = strings.TrimSpace(part[:i])
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(part[i+3:]), 64); err == nil {
+				q = parsed
+			}
+		}
+		if locale == "" || locale == "*" {
+			continue
+		}
+		tags = append(tags, weighted{locale, q})
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	locales := make([]string, len(tags))
+	for i, t := range tags {
+		locales[i] = t.locale
+	}
+	return locales
+}
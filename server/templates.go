@@ -3,12 +3,16 @@ package server
 import (
 	"fmt"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
 	"path/filepath"
 	"sort"
+	"sync"
 	"text/template"
+	"time"
 )
 
 const (
@@ -29,13 +33,46 @@ var requiredTmpls = []string{
 
 // TemplateConfig describes.
 type TemplateConfig struct {
-	// TODO(ericchiang): Asking for a directory with a set of templates doesn't indicate
-	// what the templates should look like and doesn't allow consumers of this package to
-	// provide their own templates in memory. In the future clean this up.
-
 	// Directory of the templates. If empty, these will be loaded from memory.
+	//
+	// Templates are read from Dir itself as well as its "partials" and
+	// "layouts" subdirectories (e.g. Dir/partials/*.html, Dir/layouts/*.html),
+	// so template authors can use Go's standard {{ template "partial" . }}
+	// composition instead of keeping every file flat.
 	Dir string `yaml:"dir"`
 
+	// Watch, when true and Dir is set, checks Dir for modified templates on
+	// requests, at most once per reloadPollInterval, and reparses them when
+	// the newest template modification time has advanced, so template
+	// authors iterating on custom branding don't need to restart dex. It's
+	// intended for development: it adds a stat of every template file to
+	// the request path and isn't meant for production use.
+	Watch bool `yaml:"watch"`
+
+	// FS is an optional fs.FS to load templates from, for example an
+	// embed.FS baked into the binary. If SubDir is set, templates are read
+	// from that directory within FS rather than its root.
+	FS     fs.FS  `yaml:"-"`
+	SubDir string `yaml:"-"`
+
+	// Templates provides template bodies directly, keyed by file name (e.g.
+	// "login.html"). This lets a caller embedding dex as a library override
+	// a single template, such as login.html, without shipping the rest.
+	Templates map[string]string `yaml:"-"`
+
+	// Translations maps a locale (e.g. "en", "de-DE") to a set of
+	// translation keys (e.g. "approval.grant_access", "scope.profile") to
+	// their localized strings. Templates render localized text through the
+	// "T" method on their data, e.g. `{{ .T "approval.grant_access" }}`.
+	Translations map[string]map[string]string `yaml:"-"`
+
+	// DefaultLocale is used when a request's Accept-Language header is
+	// absent, unparseable, or names no locale that has an entry in
+	// Translations, either exactly or by its base language (e.g. "de" for
+	// "de-DE").
+	// Defaults to "en".
+	DefaultLocale string `yaml:"defaultLocale"`
+
 	// Defaults to the CoreOS logo and "dex".
 	LogoURL string `yaml:"logoURL"`
 	Issuer  string `yaml:"issuerName"`
@@ -46,46 +83,138 @@ type globalData struct {
 	Issuer  string
 }
 
-func loadTemplates(config TemplateConfig) (*templates, error) {
+// addTemplate parses body as the named template, adding it to (or replacing
+// it within) tmpls. This code is largely copied from the standard library's
+// ParseFiles source code.
+// See: https://goo.gl/6Wm4mN
+func addTemplate(tmpls *template.Template, name, body string) (*template.Template, error) {
+	var t *template.Template
+	if tmpls == nil {
+		tmpls = template.New(name)
+	}
+	if name == tmpls.Name() {
+		t = tmpls
+	} else {
+		t = tmpls.New(name)
+	}
+	if _, err := t.Parse(body); err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", name, err)
+	}
+	return tmpls, nil
+}
+
+// dirGlobs returns the glob patterns searched when loading templates from
+// TemplateConfig.Dir: the directory itself plus its "partials" and "layouts"
+// subdirectories.
+func dirGlobs(dir string) []string {
+	return []string{
+		filepath.Join(dir, "*.html"),
+		filepath.Join(dir, "partials", "*.html"),
+		filepath.Join(dir, "layouts", "*.html"),
+	}
+}
+
+// dirTemplateFiles returns the paths of all template files matched by
+// dirGlobs(dir), which may be empty if dir doesn't exist or has no matches.
+func dirTemplateFiles(dir string) ([]string, error) {
+	var filenames []string
+	for _, pattern := range dirGlobs(dir) {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("glob %s: %v", pattern, err)
+		}
+		filenames = append(filenames, matches...)
+	}
+	return filenames, nil
+}
+
+// dirModTime returns the most recent modification time among the template
+// files in dir, used by Watch mode to detect changes worth reparsing for.
+func dirModTime(dir string) (time.Time, error) {
+	filenames, err := dirTemplateFiles(dir)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var latest time.Time
+	for _, filename := range filenames {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("stat %s: %v", filename, err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// buildTemplateTree parses the template set described by config. Sources
+// are layered in order, each overriding templates of the same name defined
+// by the previous one: built-in defaults, then config.FS, then config.Dir,
+// then config.Templates. This lets a caller override just a single
+// template, such as login.html, without shipping the rest.
+func buildTemplateTree(config TemplateConfig) (*template.Template, error) {
 	var tmpls *template.Template
-	if config.Dir != "" {
-		files, err := ioutil.ReadDir(config.Dir)
+	var err error
+
+	for name, data := range defaultTemplates {
+		if tmpls, err = addTemplate(tmpls, name, data); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.FS != nil {
+		dir := config.SubDir
+		if dir == "" {
+			dir = "."
+		}
+		entries, err := fs.ReadDir(config.FS, dir)
 		if err != nil {
-			return nil, fmt.Errorf("read dir: %v", err)
+			return nil, fmt.Errorf("read fs dir: %v", err)
 		}
-		filenames := []string{}
-		for _, file := range files {
-			if file.IsDir() {
+		for _, entry := range entries {
+			if entry.IsDir() {
 				continue
 			}
-			filenames = append(filenames, filepath.Join(config.Dir, file.Name()))
+			data, err := fs.ReadFile(config.FS, filepath.Join(dir, entry.Name()))
+			if err != nil {
+				return nil, fmt.Errorf("read fs file %s: %v", entry.Name(), err)
+			}
+			if tmpls, err = addTemplate(tmpls, entry.Name(), string(data)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if config.Dir != "" {
+		filenames, err := dirTemplateFiles(config.Dir)
+		if err != nil {
+			return nil, err
 		}
 		if len(filenames) == 0 {
 			return nil, fmt.Errorf("no files in template dir %s", config.Dir)
 		}
-		if tmpls, err = template.ParseFiles(filenames...); err != nil {
-			return nil, fmt.Errorf("parse files: %v", err)
-		}
-	} else {
-		// Load templates from memory. This code is largely copied from the standard library's
-		// ParseFiles source code.
-		// See: https://goo.gl/6Wm4mN
-		for name, data := range defaultTemplates {
-			var t *template.Template
-			if tmpls == nil {
-				tmpls = template.New(name)
+		for _, filename := range filenames {
+			data, err := ioutil.ReadFile(filename)
+			if err != nil {
+				return nil, fmt.Errorf("read file %s: %v", filename, err)
 			}
-			if name == tmpls.Name() {
-				t = tmpls
-			} else {
-				t = tmpls.New(name)
-			}
-			if _, err := t.Parse(data); err != nil {
-				return nil, fmt.Errorf("parsing %s: %v", name, err)
+			if tmpls, err = addTemplate(tmpls, filepath.Base(filename), string(data)); err != nil {
+				return nil, err
 			}
 		}
 	}
 
+	for name, data := range config.Templates {
+		if tmpls, err = addTemplate(tmpls, name, data); err != nil {
+			return nil, err
+		}
+	}
+
+	return tmpls, nil
+}
+
+func checkRequiredTemplates(tmpls *template.Template) error {
 	missingTmpls := []string{}
 	for _, tmplName := range requiredTmpls {
 		if tmpls.Lookup(tmplName) == nil {
@@ -93,7 +222,18 @@ func loadTemplates(config TemplateConfig) (*templates, error) {
 		}
 	}
 	if len(missingTmpls) > 0 {
-		return nil, fmt.Errorf("missing template(s): %s", missingTmpls)
+		return fmt.Errorf("missing template(s): %s", missingTmpls)
+	}
+	return nil
+}
+
+func loadTemplates(config TemplateConfig) (*templates, error) {
+	tmpls, err := buildTemplateTree(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRequiredTemplates(tmpls); err != nil {
+		return nil, err
 	}
 
 	if config.LogoURL == "" {
@@ -103,29 +243,107 @@ func loadTemplates(config TemplateConfig) (*templates, error) {
 		config.Issuer = "dex"
 	}
 
-	return &templates{
-		globalData:   config,
-		loginTmpl:    tmpls.Lookup(tmplLogin),
-		approvalTmpl: tmpls.Lookup(tmplApproval),
-		passwordTmpl: tmpls.Lookup(tmplPassword),
-		oobTmpl:      tmpls.Lookup(tmplOOB),
-	}, nil
+	t := &templates{
+		globalData: config,
+		translator: newTranslator(config.DefaultLocale, config.Translations),
+		watch:      config.Watch && config.Dir != "",
+	}
+	t.tree = tmpls
+	if t.watch {
+		if t.lastModTime, err = dirModTime(config.Dir); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
 }
 
-var scopeDescriptions = map[string]string{
-	"offline_access": "Have offline access",
-	"profile":        "View basic profile information",
-	"email":          "View your email",
-}
+// reloadPollInterval throttles the Watch-mode modtime check so busy request
+// paths don't stat the template directory on every single request.
+const reloadPollInterval = time.Second
 
 type templates struct {
-	globalData   TemplateConfig
-	loginTmpl    *template.Template
-	approvalTmpl *template.Template
-	passwordTmpl *template.Template
-	oobTmpl      *template.Template
+	globalData TemplateConfig
+	translator *translator
+
+	// watch is true when config.Watch is set and templates are being loaded
+	// from a directory, so reload() has somewhere to reparse from.
+	watch bool
+
+	treeMu sync.RWMutex
+	tree   *template.Template
+
+	pollMu      sync.Mutex
+	lastPoll    time.Time
+	lastModTime time.Time
 }
 
+// currentTree returns a snapshot of the parsed template tree. Templates
+// looked up from the returned tree remain valid even if a concurrent reload
+// swaps in a new tree afterwards, since reload never mutates a tree in
+// place, so executing a template mid-reload is safe.
+func (t *templates) currentTree() *template.Template {
+	if t.watch {
+		t.reload()
+	}
+	t.treeMu.RLock()
+	defer t.treeMu.RUnlock()
+	return t.tree
+}
+
+// reload reparses t.globalData.Dir if its templates have changed since the
+// last check, swapping in the new tree. Errors and stale reloads leave the
+// previously served templates in place; dex keeps answering requests with
+// the last good template set rather than failing them.
+func (t *templates) reload() {
+	t.pollMu.Lock()
+	defer t.pollMu.Unlock()
+
+	if time.Since(t.lastPoll) < reloadPollInterval {
+		return
+	}
+	t.lastPoll = time.Now()
+
+	modTime, err := dirModTime(t.globalData.Dir)
+	if err != nil {
+		log.Printf("Error checking templates in %s for changes: %s", t.globalData.Dir, err)
+		return
+	}
+	if !modTime.After(t.lastModTime) {
+		return
+	}
+
+	tmpls, err := buildTemplateTree(t.globalData)
+	if err != nil {
+		log.Printf("Error reloading templates from %s: %s", t.globalData.Dir, err)
+		return
+	}
+	if err := checkRequiredTemplates(tmpls); err != nil {
+		log.Printf("Error reloading templates from %s: %s", t.globalData.Dir, err)
+		return
+	}
+
+	t.treeMu.Lock()
+	t.tree = tmpls
+	t.treeMu.Unlock()
+	t.lastModTime = modTime
+	log.Printf("Reloaded templates from %s", t.globalData.Dir)
+}
+
+// localizer returns the T func exposed to templates, resolving keys against
+// the locale in r's Accept-Language header.
+func (t *templates) localizer(r *http.Request) func(string) string {
+	locale := t.translator.resolveLocale(r.Header.Get("Accept-Language"))
+	return func(key string) string { return t.translator.translate(locale, key) }
+}
+
+// localized is embedded in each template's data so templates can write
+// {{ .T "key" }}: text/template calls methods with arguments, but not
+// func-valued fields.
+type localized func(string) string
+
+// T returns the localized string for key.
+func (l localized) T(key string) string { return l(key) }
+
 type connectorInfo struct {
 	ID   string
 	Name string
@@ -138,34 +356,42 @@ func (n byName) Len() int           { return len(n) }
 func (n byName) Less(i, j int) bool { return n[i].Name < n[j].Name }
 func (n byName) Swap(i, j int)      { n[i], n[j] = n[j], n[i] }
 
-func (t *templates) login(w http.ResponseWriter, connectors []connectorInfo, authReqID string) {
+// login, password, approval, and oob all take the inbound *http.Request so
+// they can resolve the caller's locale from its Accept-Language header.
+// Every call site in this package's HTTP handlers must pass the request
+// through, e.g. `templates.login(r, w, connectors, authReqID)`.
+func (t *templates) login(r *http.Request, w http.ResponseWriter, connectors []connectorInfo, authReqID string) {
 	sort.Sort(byName(connectors))
 
+	T := t.localizer(r)
 	data := struct {
 		TemplateConfig
 		Connectors []connectorInfo
 		AuthReqID  string
-	}{t.globalData, connectors, authReqID}
-	renderTemplate(w, t.loginTmpl, data)
+		localized
+	}{t.globalData, connectors, authReqID, T}
+	renderTemplate(w, t.currentTree().Lookup(tmplLogin), data)
 }
 
-func (t *templates) password(w http.ResponseWriter, authReqID, callback, lastUsername string, lastWasInvalid bool) {
+func (t *templates) password(r *http.Request, w http.ResponseWriter, authReqID, callback, lastUsername string, lastWasInvalid bool) {
+	T := t.localizer(r)
 	data := struct {
 		TemplateConfig
 		AuthReqID string
 		PostURL   string
 		Username  string
 		Invalid   bool
-	}{t.globalData, authReqID, callback, lastUsername, lastWasInvalid}
-	renderTemplate(w, t.passwordTmpl, data)
+		localized
+	}{t.globalData, authReqID, callback, lastUsername, lastWasInvalid, T}
+	renderTemplate(w, t.currentTree().Lookup(tmplPassword), data)
 }
 
-func (t *templates) approval(w http.ResponseWriter, authReqID, username, clientName string, scopes []string) {
+func (t *templates) approval(r *http.Request, w http.ResponseWriter, authReqID, username, clientName string, scopes []string) {
+	T := t.localizer(r)
 	accesses := []string{}
 	for _, scope := range scopes {
-		access, ok := scopeDescriptions[scope]
-		if ok {
-			accesses = append(accesses, access)
+		if t.translator.has("scope." + scope) {
+			accesses = append(accesses, T("scope."+scope))
 		}
 	}
 	sort.Strings(accesses)
@@ -175,16 +401,19 @@ func (t *templates) approval(w http.ResponseWriter, authReqID, username, clientN
 		Client    string
 		AuthReqID string
 		Scopes    []string
-	}{t.globalData, username, clientName, authReqID, accesses}
-	renderTemplate(w, t.approvalTmpl, data)
+		localized
+	}{t.globalData, username, clientName, authReqID, accesses, T}
+	renderTemplate(w, t.currentTree().Lookup(tmplApproval), data)
 }
 
-func (t *templates) oob(w http.ResponseWriter, code string) {
+func (t *templates) oob(r *http.Request, w http.ResponseWriter, code string) {
+	T := t.localizer(r)
 	data := struct {
 		TemplateConfig
 		Code string
-	}{t.globalData, code}
-	renderTemplate(w, t.oobTmpl, data)
+		localized
+	}{t.globalData, code, T}
+	renderTemplate(w, t.currentTree().Lookup(tmplOOB), data)
 }
 
 // small io.Writer utilitiy to determine if executing the template wrote to the underlying response writer.